@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// BanKind identifies which field of an incoming client a Ban matches against.
+type BanKind string
+
+const (
+	BanByName    BanKind = "NAME"
+	BanByIp      BanKind = "IP"
+	BanByBuildId BanKind = "BUILD_ID"
+)
+
+// Ban is a single entry in the ban list. Expiry is the zero time.Time for a
+// permanent ban.
+type Ban struct {
+	Kind   BanKind
+	Value  string
+	Expiry time.Time
+}
+
+func (b *Ban) isExpired(now time.Time) bool {
+	return !b.Expiry.IsZero() && now.After(b.Expiry)
+}
+
+// BanStore is a persistent, in-memory list of bans. It is safe for
+// concurrent use and is rewritten to disk on every mutation. Each node in a
+// cluster keeps its own BanStore backed by its own file; HandleBAN/HandleUNBAN
+// replicate adds/removes to every other node via ClusterEventBanAdd/
+// ClusterEventBanRemove (see runClusterEventLoop), so the store only needs to
+// be local, not because bans are meant to be node-scoped.
+type BanStore struct {
+	mutex     sync.Mutex
+	path      string
+	bans      []Ban
+	sweepGate func() bool
+	logger    Logger
+}
+
+// NewBanStore loads bans from path if it exists and returns a BanStore that
+// will persist future changes back to the same file, logging load/save
+// failures through logger.
+func NewBanStore(path string, logger Logger) *BanStore {
+	store := &BanStore{path: path, logger: logger}
+	store.load()
+	return store
+}
+
+func (s *BanStore) load() {
+	if s.path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Warnw("could not read ban file", "path", s.path, "error", err)
+		}
+		return
+	}
+	var bans []Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		s.logger.Warnw("could not parse ban file", "path", s.path, "error", err)
+		return
+	}
+	s.bans = bans
+}
+
+// save rewrites the ban file atomically by writing to a temporary file in
+// the same directory and renaming it over the original.
+func (s *BanStore) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.bans, "", "  ")
+	if err != nil {
+		s.logger.Errorw("could not marshal bans", "error", err)
+		return
+	}
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		s.logger.Errorw("could not write ban file", "path", tmpPath, "error", err)
+		return
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		s.logger.Errorw("could not rename ban file into place", "from", tmpPath, "to", s.path, "error", err)
+	}
+}
+
+// Add inserts a new ban, replacing any existing ban of the same kind/value.
+func (s *BanStore) Add(kind BanKind, value string, duration time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var expiry time.Time
+	if duration != 0 {
+		expiry = time.Now().Add(duration)
+	}
+	for i := range s.bans {
+		if s.bans[i].Kind == kind && s.bans[i].Value == value {
+			s.bans[i].Expiry = expiry
+			s.save()
+			return
+		}
+	}
+	s.bans = append(s.bans, Ban{Kind: kind, Value: value, Expiry: expiry})
+	s.save()
+}
+
+// Remove deletes any ban matching kind/value. It returns false if no such
+// ban existed.
+func (s *BanStore) Remove(kind BanKind, value string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.bans {
+		if s.bans[i].Kind == kind && s.bans[i].Value == value {
+			s.bans = append(s.bans[:i], s.bans[i+1:]...)
+			s.save()
+			return true
+		}
+	}
+	return false
+}
+
+// Matching returns the Ban that applies to the given name/ip/buildId, or nil
+// if none of them are banned. Expired bans are ignored.
+func (s *BanStore) Matching(name, ip, buildId string) *Ban {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for i := range s.bans {
+		ban := &s.bans[i]
+		if ban.isExpired(now) {
+			continue
+		}
+		switch ban.Kind {
+		case BanByName:
+			if ban.Value == name {
+				return ban
+			}
+		case BanByIp:
+			if ban.Value == ip {
+				return ban
+			}
+		case BanByBuildId:
+			if ban.Value == buildId {
+				return ban
+			}
+		}
+	}
+	return nil
+}
+
+// List returns a snapshot copy of the currently active (non-expired) bans.
+func (s *BanStore) List() []Ban {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	result := make([]Ban, 0, len(s.bans))
+	for _, ban := range s.bans {
+		if !ban.isExpired(now) {
+			result = append(result, ban)
+		}
+	}
+	return result
+}
+
+// sweepExpired drops all bans that have expired, persisting if anything
+// changed.
+func (s *BanStore) sweepExpired() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	remaining := s.bans[:0]
+	changed := false
+	for _, ban := range s.bans {
+		if ban.isExpired(now) {
+			changed = true
+			continue
+		}
+		remaining = append(remaining, ban)
+	}
+	s.bans = remaining
+	if changed {
+		s.save()
+	}
+}
+
+// SetSweepGate restricts sweeping to ticks where shouldSweep() returns true,
+// e.g. so that only the elected leader of a cluster spends the work of
+// expiring bans. A nil gate (the default) sweeps on every tick.
+func (s *BanStore) SetSweepGate(shouldSweep func() bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sweepGate = shouldSweep
+}
+
+// RunSweeper periodically expires timed bans until stop is closed.
+func (s *BanStore) RunSweeper(interval time.Duration, stop <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			gate := s.sweepGate
+			s.mutex.Unlock()
+			if gate != nil && !gate() {
+				continue
+			}
+			s.sweepExpired()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// NOCOM(sirver): HandleBAN/HandleLOGIN themselves are not covered here. Doing
+// so needs a fake Client/UserDb pair to drive them end to end, and neither
+// type lives in this tree (client.go, along with Permissions and
+// packet.Packet, is not part of this checkout) -- so BanStore is exercised
+// directly instead, and the wiring in HandleBAN/HandleLOGIN is left to
+// whoever owns client.go to cover alongside the rest of that file's tests.
+
+func TestBanStoreMatchingByEachKind(t *testing.T) {
+	store := NewBanStore("", nil)
+	store.Add(BanByName, "spammer", 0)
+	store.Add(BanByIp, "1.2.3.4", 0)
+	store.Add(BanByBuildId, "bad-build", 0)
+
+	if ban := store.Matching("spammer", "9.9.9.9", "ok-build"); ban == nil || ban.Kind != BanByName {
+		t.Fatalf("expected name ban to match, got %v", ban)
+	}
+	if ban := store.Matching("nobody", "1.2.3.4", "ok-build"); ban == nil || ban.Kind != BanByIp {
+		t.Fatalf("expected ip ban to match, got %v", ban)
+	}
+	if ban := store.Matching("nobody", "9.9.9.9", "bad-build"); ban == nil || ban.Kind != BanByBuildId {
+		t.Fatalf("expected build id ban to match, got %v", ban)
+	}
+	if ban := store.Matching("nobody", "9.9.9.9", "ok-build"); ban != nil {
+		t.Fatalf("expected no ban to match, got %v", ban)
+	}
+}
+
+func TestBanStoreExpiry(t *testing.T) {
+	store := NewBanStore("", nil)
+	store.Add(BanByName, "temp", time.Hour)
+
+	if ban := store.Matching("temp", "", ""); ban == nil {
+		t.Fatalf("expected active timed ban to match")
+	}
+
+	store.mutex.Lock()
+	store.bans[0].Expiry = time.Now().Add(-time.Second)
+	store.mutex.Unlock()
+
+	if ban := store.Matching("temp", "", ""); ban != nil {
+		t.Fatalf("expected expired ban to no longer match, got %v", ban)
+	}
+}
+
+func TestBanStoreSweepExpired(t *testing.T) {
+	store := NewBanStore("", nil)
+	store.Add(BanByName, "temp", time.Hour)
+	store.Add(BanByName, "permanent", 0)
+
+	store.mutex.Lock()
+	store.bans[0].Expiry = time.Now().Add(-time.Second)
+	store.mutex.Unlock()
+
+	store.sweepExpired()
+
+	remaining := store.List()
+	if len(remaining) != 1 || remaining[0].Value != "permanent" {
+		t.Fatalf("expected only the permanent ban to survive the sweep, got %v", remaining)
+	}
+}
+
+func TestBanStoreAddReplacesExistingBan(t *testing.T) {
+	store := NewBanStore("", nil)
+	store.Add(BanByName, "user", time.Hour)
+	store.Add(BanByName, "user", 0)
+
+	bans := store.List()
+	if len(bans) != 1 {
+		t.Fatalf("expected re-adding the same kind/value to replace, not append, got %v", bans)
+	}
+	if !bans[0].Expiry.IsZero() {
+		t.Fatalf("expected the replacement ban to be permanent, got expiry %v", bans[0].Expiry)
+	}
+}
+
+func TestBanStoreRemove(t *testing.T) {
+	store := NewBanStore("", nil)
+	store.Add(BanByName, "user", 0)
+
+	if !store.Remove(BanByName, "user") {
+		t.Fatalf("expected Remove to report success for an existing ban")
+	}
+	if store.Remove(BanByName, "user") {
+		t.Fatalf("expected Remove to report failure for an already-removed ban")
+	}
+	if len(store.List()) != 0 {
+		t.Fatalf("expected no bans to remain")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// newServerId returns a random identifier this node uses to tag the
+// ClusterEvents it publishes, so it can recognize (and skip) its own
+// broadcasts when they come back over the bus.
+func newServerId(logger Logger) string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Errorw("cluster: could not generate server id", "error", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// ClusterEventType names the kind of state change being replicated between
+// metaserver nodes.
+type ClusterEventType string
+
+const (
+	ClusterEventChat          ClusterEventType = "chat"
+	ClusterEventPresenceJoin  ClusterEventType = "presence_join"
+	ClusterEventPresenceLeave ClusterEventType = "presence_leave"
+	ClusterEventMotdSet       ClusterEventType = "motd_set"
+	ClusterEventBanAdd        ClusterEventType = "ban_add"
+	ClusterEventBanRemove     ClusterEventType = "ban_remove"
+)
+
+// ClusterEvent is the wire format published to and received from the
+// cluster backend. ServerId identifies the node that originated the event so
+// that a node can recognize (and skip) its own broadcasts.
+type ClusterEvent struct {
+	Type         ClusterEventType
+	ServerId     string
+	Sender       string
+	Message      string
+	Receiver     string
+	TargetServer string
+	BuildId      string
+	Permissions  Permissions
+	BanKind      BanKind
+	BanValue     string
+	BanExpiry    time.Time
+}
+
+// ClusterBackend fans ClusterEvents out to every other node sharing the same
+// bus. Publish is fire-and-forget; Subscribe returns a channel that is
+// closed when the backend shuts down.
+type ClusterBackend interface {
+	Publish(event ClusterEvent) error
+	Subscribe() <-chan ClusterEvent
+	Close() error
+}
+
+// remoteClient is the subset of Client state a node needs to know about a
+// client that is logged into a different node of the cluster, so that
+// isLoggedIn and CLIENTS_UPDATE can present a merged view.
+type remoteClient struct {
+	name        string
+	buildId     string
+	permissions Permissions
+	serverId    string
+}
+
+// clusterState tracks the merged view of clients logged in on other nodes
+// and mediates publishing/receiving ClusterEvents on behalf of a Server.
+// remoteByName is read from every client goroutine (HandleLOGIN, HandleCHAT)
+// and written from the single runClusterEventLoop goroutine, so it is guarded
+// by remoteByNameMutex rather than left to the caller.
+type clusterState struct {
+	backend           ClusterBackend
+	serverId          string
+	remoteByNameMutex sync.RWMutex
+	remoteByName      map[string]*remoteClient
+	logger            Logger
+}
+
+func newClusterState(backend ClusterBackend, serverId string, logger Logger) *clusterState {
+	return &clusterState{
+		backend:      backend,
+		serverId:     serverId,
+		remoteByName: make(map[string]*remoteClient),
+		logger:       logger,
+	}
+}
+
+func (c *clusterState) publish(event ClusterEvent) {
+	if c == nil || c.backend == nil {
+		return
+	}
+	event.ServerId = c.serverId
+	if err := c.backend.Publish(event); err != nil {
+		c.logger.Warnw("cluster: publish failed", "error", err)
+	}
+}
+
+// isLoggedInRemotely reports whether name is currently known to be logged in
+// on a different node, so HandleLOGIN's uniqueness check can span the
+// cluster.
+func (c *clusterState) isLoggedInRemotely(name string) bool {
+	_, found := c.findRemote(name)
+	return found
+}
+
+// findRemote looks up a remote client by name, safe to call on a nil
+// clusterState (i.e. when clustering is disabled).
+func (c *clusterState) findRemote(name string) (*remoteClient, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.remoteByNameMutex.RLock()
+	defer c.remoteByNameMutex.RUnlock()
+	remote, found := c.remoteByName[name]
+	return remote, found
+}
+
+// apply folds an incoming ClusterEvent from another node into the merged
+// remote-client view. It is the Server's responsibility to turn the event
+// into local side effects (chat delivery, CLIENTS_UPDATE, MOTD, bans) once
+// this returns.
+func (c *clusterState) apply(event ClusterEvent) {
+	if event.ServerId == c.serverId {
+		return // Loopback of our own event.
+	}
+	switch event.Type {
+	case ClusterEventPresenceJoin:
+		c.remoteByNameMutex.Lock()
+		c.remoteByName[event.Sender] = &remoteClient{
+			name:        event.Sender,
+			buildId:     event.BuildId,
+			permissions: event.Permissions,
+			serverId:    event.ServerId,
+		}
+		c.remoteByNameMutex.Unlock()
+	case ClusterEventPresenceLeave:
+		c.remoteByNameMutex.Lock()
+		delete(c.remoteByName, event.Sender)
+		c.remoteByNameMutex.Unlock()
+	}
+}
+
+func (event ClusterEvent) marshal() ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func unmarshalClusterEvent(data []byte) (ClusterEvent, error) {
+	var event ClusterEvent
+	err := json.Unmarshal(data, &event)
+	return event, err
+}
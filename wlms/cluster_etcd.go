@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// electionRetryBackoff is how long runElection waits after a failed
+// campaign attempt (e.g. the etcd cluster being briefly unreachable) before
+// trying again, so a persistent failure doesn't turn into a hot retry loop
+// hammering etcd.
+const electionRetryBackoff = 5 * time.Second
+
+// etcdBackend is a ClusterBackend built on etcd's watch API for fanout and
+// its concurrency primitives for leader election. IsLeader reports which
+// single node currently holds the election, which Server uses to gate
+// cluster-wide singleton work such as ban sweeping; every node still
+// publishes and receives events regardless of who holds the lock.
+type etcdBackend struct {
+	client         *clientv3.Client
+	key            string
+	electionPrefix string
+	events         chan ClusterEvent
+	cancel         context.CancelFunc
+	logger         Logger
+
+	sessionMutex sync.Mutex
+	session      *concurrency.Session
+	election     *concurrency.Election
+
+	leading int32
+}
+
+// NewEtcdBackend connects to the etcd cluster at the given endpoints and
+// joins both the event-fanout key and leader-election prefix derived from
+// electionPrefix.
+func NewEtcdBackend(endpoints []string, electionPrefix string, logger Logger) (ClusterBackend, error) {
+	client, err := clientv3.New(clientv3.Config{Endpoints: endpoints})
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := concurrency.NewSession(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := &etcdBackend{
+		client:         client,
+		session:        session,
+		election:       concurrency.NewElection(session, electionPrefix),
+		key:            electionPrefix + "/events",
+		electionPrefix: electionPrefix,
+		events:         make(chan ClusterEvent, 64),
+		cancel:         cancel,
+		logger:         logger,
+	}
+
+	watch := client.Watch(ctx, backend.key)
+	go func() {
+		for response := range watch {
+			for _, ev := range response.Events {
+				if ev.Type != clientv3.EventTypePut {
+					continue
+				}
+				event, err := unmarshalClusterEvent(ev.Kv.Value)
+				if err != nil {
+					continue
+				}
+				backend.events <- event
+			}
+		}
+	}()
+
+	go backend.runElection(ctx)
+
+	return backend, nil
+}
+
+// runElection repeatedly campaigns for leadership, keeping backend.leading
+// in sync: it flips to true once this node wins, and back to false once the
+// session backing the campaign ends (losing the connection, or the process
+// shutting down via ctx). A concurrency.Session/Election is single-use once
+// its session ends -- every subsequent Campaign on it fails -- so each time
+// that happens this builds a fresh Session/Election before re-campaigning,
+// backing off between attempts so a persistently unreachable etcd cluster
+// doesn't turn into a hot retry loop.
+func (b *etcdBackend) runElection(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		session, err := concurrency.NewSession(b.client, concurrency.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			b.logger.Warnw("cluster: could not open etcd session for leader election, retrying", "error", err)
+			if !b.sleepOrDone(ctx, electionRetryBackoff) {
+				return
+			}
+			continue
+		}
+		election := concurrency.NewElection(session, b.electionPrefix)
+
+		b.sessionMutex.Lock()
+		b.session, b.election = session, election
+		b.sessionMutex.Unlock()
+
+		if err := election.Campaign(ctx, ""); err != nil {
+			session.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			b.logger.Warnw("cluster: etcd leader campaign failed, retrying", "error", err)
+			if !b.sleepOrDone(ctx, electionRetryBackoff) {
+				return
+			}
+			continue
+		}
+		atomic.StoreInt32(&b.leading, 1)
+
+		select {
+		case <-session.Done():
+			atomic.StoreInt32(&b.leading, 0)
+		case <-ctx.Done():
+			atomic.StoreInt32(&b.leading, 0)
+			return
+		}
+	}
+}
+
+// sleepOrDone waits for d, returning false early (without having slept) if
+// ctx is cancelled first.
+func (b *etcdBackend) sleepOrDone(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// IsLeader reports whether this node currently holds the election, as
+// observed by BanStore.SetSweepGate.
+func (b *etcdBackend) IsLeader() bool {
+	return atomic.LoadInt32(&b.leading) == 1
+}
+
+func (b *etcdBackend) Publish(event ClusterEvent) error {
+	data, err := event.marshal()
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Put(context.Background(), b.key, string(data))
+	return err
+}
+
+func (b *etcdBackend) Subscribe() <-chan ClusterEvent {
+	return b.events
+}
+
+func (b *etcdBackend) Close() error {
+	b.cancel()
+	b.sessionMutex.Lock()
+	b.session.Close()
+	b.sessionMutex.Unlock()
+	close(b.events)
+	return b.client.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+// natsBackend is a ClusterBackend that fans events out over a NATS subject.
+// It is the simplest backend to operate: no leader election, just
+// publish/subscribe on a shared subject name.
+type natsBackend struct {
+	conn    *nats.Conn
+	sub     *nats.Subscription
+	subject string
+	events  chan ClusterEvent
+}
+
+// NewNatsBackend connects to a NATS server at url and joins subject, which
+// all nodes of the cluster must share.
+func NewNatsBackend(url, subject string) (ClusterBackend, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &natsBackend{
+		conn:    conn,
+		subject: subject,
+		events:  make(chan ClusterEvent, 64),
+	}
+
+	sub, err := conn.Subscribe(subject, func(msg *nats.Msg) {
+		event, err := unmarshalClusterEvent(msg.Data)
+		if err != nil {
+			return
+		}
+		backend.events <- event
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	backend.sub = sub
+
+	return backend, nil
+}
+
+func (b *natsBackend) Publish(event ClusterEvent) error {
+	data, err := event.marshal()
+	if err != nil {
+		return err
+	}
+	return b.conn.Publish(b.subject, data)
+}
+
+func (b *natsBackend) Subscribe() <-chan ClusterEvent {
+	return b.events
+}
+
+func (b *natsBackend) Close() error {
+	if err := b.sub.Unsubscribe(); err != nil {
+		return err
+	}
+	b.conn.Close()
+	close(b.events)
+	return nil
+}
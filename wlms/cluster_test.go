@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestClusterStateConcurrentApplyAndFindRemote is a regression test for a
+// data race between runClusterEventLoop's apply() (writer) and
+// HandleLOGIN/HandleCHAT's findRemote()/isLoggedInRemotely() (readers) on
+// remoteByName. Run with -race to catch a regression.
+func TestClusterStateConcurrentApplyAndFindRemote(t *testing.T) {
+	logger, err := NewZapLogger("error", LogEncodingConsole)
+	if err != nil {
+		t.Fatalf("could not build logger: %v", err)
+	}
+	cluster := newClusterState(nil, "local", logger)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			name := "user" + strconv.Itoa(i%10)
+			cluster.apply(ClusterEvent{Type: ClusterEventPresenceJoin, ServerId: "remote", Sender: name})
+			cluster.apply(ClusterEvent{Type: ClusterEventPresenceLeave, ServerId: "remote", Sender: name})
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			name := "user" + strconv.Itoa(i%10)
+			cluster.findRemote(name)
+			cluster.isLoggedInRemotely(name)
+		}
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"go.uber.org/zap"
+)
+
+// Logger is the subset of zap.SugaredLogger's API the server relies on. It
+// is an interface rather than a concrete type so a thin wrapper around
+// zerolog or another structured logger can be plugged in via
+// CreateServerUsing's WithLogger option.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+	With(keysAndValues ...interface{}) Logger
+}
+
+// sugaredLogger adapts *zap.SugaredLogger to the Logger interface.
+type sugaredLogger struct {
+	*zap.SugaredLogger
+}
+
+func (l sugaredLogger) With(keysAndValues ...interface{}) Logger {
+	return sugaredLogger{l.SugaredLogger.With(keysAndValues...)}
+}
+
+// LogEncoding selects how log lines are rendered.
+type LogEncoding string
+
+const (
+	LogEncodingConsole LogEncoding = "console"
+	LogEncodingJson    LogEncoding = "json"
+)
+
+// NewZapLogger builds the server's default Logger at the given level
+// ("debug", "info", "warn", "error") using either the human-readable
+// console encoder or JSON, the latter being friendlier to Loki/ELK-style
+// log shipping.
+func NewZapLogger(level string, encoding LogEncoding) (Logger, error) {
+	var zapLevel zap.AtomicLevel
+	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+
+	config := zap.NewProductionConfig()
+	if encoding == LogEncodingConsole {
+		config = zap.NewDevelopmentConfig()
+	}
+	config.Level = zapLevel
+	config.Encoding = string(encoding)
+
+	logger, err := config.Build()
+	if err != nil {
+		return nil, err
+	}
+	return sugaredLogger{logger.Sugar()}, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a simple token bucket: tokens regenerate at rate per
+// second, up to a maximum of burst, and are consumed one at a time by
+// Allow().
+type RateLimiter struct {
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  float64
+}
+
+// NewRateLimiter creates a RateLimiter that allows burst calls to Allow() to
+// succeed immediately, refilling at rate tokens per second afterwards.
+func NewRateLimiter(rate, burst float64) *RateLimiter {
+	return &RateLimiter{
+		tokens: burst,
+		last:   time.Now(),
+		rate:   rate,
+		burst:  burst,
+	}
+}
+
+// Allow reports whether a single token is available right now, consuming it
+// if so.
+func (r *RateLimiter) Allow() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// keyedRateLimiter is a RateLimiter plus the last time it was touched, used
+// by keyedRateLimiters to know which entries are idle enough to prune.
+type keyedRateLimiter struct {
+	limiter  *RateLimiter
+	lastUsed time.Time
+}
+
+// keyedRateLimiters hands out one RateLimiter per string key (e.g. a remote
+// IP), creating it lazily on first use. Idle entries are dropped by
+// PruneIdle so the map does not grow unboundedly as transient clients come
+// and go.
+type keyedRateLimiters struct {
+	mutex       sync.Mutex
+	byKey       map[string]*keyedRateLimiter
+	rate, burst float64
+}
+
+func newKeyedRateLimiters(rate, burst float64) *keyedRateLimiters {
+	return &keyedRateLimiters{
+		byKey: make(map[string]*keyedRateLimiter),
+		rate:  rate,
+		burst: burst,
+	}
+}
+
+// SetRateBurst changes the rate/burst applied to buckets created from now
+// on, and to every bucket that already exists, so callers can reconfigure a
+// limiter in place (e.g. via a Server Set* method) without orphaning any
+// goroutine already running against this *keyedRateLimiters.
+func (k *keyedRateLimiters) SetRateBurst(rate, burst float64) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.rate = rate
+	k.burst = burst
+	for _, entry := range k.byKey {
+		entry.limiter.mutex.Lock()
+		entry.limiter.rate = rate
+		entry.limiter.burst = burst
+		entry.limiter.mutex.Unlock()
+	}
+}
+
+// Allow reports whether key's bucket currently has a token available,
+// creating a fresh bucket for keys seen for the first time.
+func (k *keyedRateLimiters) Allow(key string) bool {
+	k.mutex.Lock()
+	entry, found := k.byKey[key]
+	if !found {
+		entry = &keyedRateLimiter{limiter: NewRateLimiter(k.rate, k.burst)}
+		k.byKey[key] = entry
+	}
+	entry.lastUsed = time.Now()
+	k.mutex.Unlock()
+
+	return entry.limiter.Allow()
+}
+
+// PruneIdle removes every entry that has not been used within maxIdle.
+func (k *keyedRateLimiters) PruneIdle(maxIdle time.Duration) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	cutoff := time.Now().Add(-maxIdle)
+	for key, entry := range k.byKey {
+		if entry.lastUsed.Before(cutoff) {
+			delete(k.byKey, key)
+		}
+	}
+}
+
+// RunPruner periodically removes idle entries until stop is closed.
+func (k *keyedRateLimiters) RunPruner(interval, maxIdle time.Duration, stop <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			k.PruneIdle(maxIdle)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllowsBurstThenBlocks(t *testing.T) {
+	limiter := NewRateLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow() {
+			t.Fatalf("expected call %d within burst to be allowed", i)
+		}
+	}
+	if limiter.Allow() {
+		t.Fatalf("expected call beyond burst to be denied")
+	}
+}
+
+func TestRateLimiterRefillsOverTime(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	if !limiter.Allow() {
+		t.Fatalf("expected first call to be allowed")
+	}
+	if limiter.Allow() {
+		t.Fatalf("expected immediate second call to be denied")
+	}
+
+	// Simulate a tokens/second refill by rewinding "last" instead of
+	// sleeping in the test.
+	limiter.last = limiter.last.Add(-2 * time.Second)
+	if !limiter.Allow() {
+		t.Fatalf("expected call after refill window to be allowed")
+	}
+}
+
+func TestKeyedRateLimitersIsolatesKeys(t *testing.T) {
+	limiters := newKeyedRateLimiters(1, 1)
+
+	if !limiters.Allow("1.2.3.4") {
+		t.Fatalf("expected first call for a new key to be allowed")
+	}
+	if limiters.Allow("1.2.3.4") {
+		t.Fatalf("expected second call for the same key to be denied")
+	}
+	if !limiters.Allow("5.6.7.8") {
+		t.Fatalf("expected a different key to have its own bucket")
+	}
+}
+
+func TestKeyedRateLimitersSetRateBurstAppliesToExistingEntries(t *testing.T) {
+	limiters := newKeyedRateLimiters(1, 1)
+	limiters.Allow("1.2.3.4")
+
+	limiters.SetRateBurst(1, 5)
+
+	limiters.mutex.Lock()
+	entry := limiters.byKey["1.2.3.4"]
+	limiters.mutex.Unlock()
+	if entry.limiter.burst != 5 {
+		t.Fatalf("expected existing bucket's burst to be updated in place, got %v", entry.limiter.burst)
+	}
+}
+
+func TestKeyedRateLimitersPruneIdle(t *testing.T) {
+	limiters := newKeyedRateLimiters(1, 1)
+	limiters.Allow("1.2.3.4")
+
+	limiters.mutex.Lock()
+	limiters.byKey["1.2.3.4"].lastUsed = time.Now().Add(-time.Hour)
+	limiters.mutex.Unlock()
+
+	limiters.PruneIdle(time.Minute)
+
+	limiters.mutex.Lock()
+	_, found := limiters.byKey["1.2.3.4"]
+	limiters.mutex.Unlock()
+	if found {
+		t.Fatalf("expected idle entry to be pruned")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,9 +20,162 @@ type Server struct {
 	clients             *list.List
 	user_db             UserDb
 	motd                string
+	ban_store           *BanStore
+	banSweeperStop      chan bool
+	cluster             *clusterState
+	logger              Logger
+
+	chatLimiters          map[*Client]*RateLimiter
+	chatLimitersMutex     sync.Mutex
+	clientLoggers         map[*Client]Logger
+	clientLoggersMutex    sync.Mutex
+	chatLimiterRate       float64
+	chatLimiterBurst      float64
+	loginLimiters         *keyedRateLimiters
+	loginLimiterPruneStop chan bool
 
 	clientSendingTimeout time.Duration
 	pingCycleTime        time.Duration
+	loginTimeout         time.Duration
+}
+
+// ServerOption configures optional behavior on CreateServerUsing, following
+// the same spirit as the Set* methods below but for settings that only make
+// sense at construction time.
+type ServerOption func(*Server)
+
+// WithLogger overrides the server's default logger (a console-encoded,
+// info-level zap logger) with logger.
+func WithLogger(logger Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithLogLevelAndEncoding builds the default zap-backed logger at the given
+// level ("debug", "info", "warn", "error") and encoding, so operators can
+// switch to JSON output for shipping to Loki/ELK without touching code.
+func WithLogLevelAndEncoding(level string, encoding LogEncoding) ServerOption {
+	return func(s *Server) {
+		logger, err := NewZapLogger(level, encoding)
+		if err != nil {
+			log.Printf("could not build logger from level %q: %v; keeping default", level, err)
+			return
+		}
+		s.logger = logger
+	}
+}
+
+// registerClientLogger derives client's logger from the server's base
+// logger, tagged with remote_addr, and caches it so every subsequent log
+// call for this client reuses the same child logger instead of re-deriving
+// one from scratch. Called once the connection is accepted.
+func (s *Server) registerClientLogger(client *Client) {
+	s.clientLoggersMutex.Lock()
+	defer s.clientLoggersMutex.Unlock()
+	s.clientLoggers[client] = s.logger.With("remote_addr", client.RemoteAddr())
+}
+
+// promoteClientLogger adds the fields only known once LOGIN succeeds
+// (user/build_id/permissions) to client's cached logger, so they show up on
+// every message from here on without being re-derived each time.
+func (s *Server) promoteClientLogger(client *Client) {
+	s.clientLoggersMutex.Lock()
+	defer s.clientLoggersMutex.Unlock()
+	base, found := s.clientLoggers[client]
+	if !found {
+		base = s.logger.With("remote_addr", client.RemoteAddr())
+	}
+	s.clientLoggers[client] = base.With(
+		"user", client.Name(),
+		"build_id", client.BuildId(),
+		"permissions", client.Permissions().String(),
+	)
+}
+
+// unregisterClientLogger forgets client's cached logger. Called once the
+// client disconnects.
+func (s *Server) unregisterClientLogger(client *Client) {
+	s.clientLoggersMutex.Lock()
+	defer s.clientLoggersMutex.Unlock()
+	delete(s.clientLoggers, client)
+}
+
+// clientLogger returns the Logger cached for client, tagged with whatever
+// is known about it so far (just remote_addr before LOGIN succeeds; also
+// user/build_id/permissions afterwards).
+func (s *Server) clientLogger(client *Client) Logger {
+	s.clientLoggersMutex.Lock()
+	defer s.clientLoggersMutex.Unlock()
+	if logger, found := s.clientLoggers[client]; found {
+		return logger
+	}
+	return s.logger.With("remote_addr", client.RemoteAddr())
+}
+
+// SetClusterBackend makes this server share chat, presence and MOTD state
+// with every other node publishing/subscribing through backend. It also
+// starts the goroutine that applies incoming events to the local view.
+func (s *Server) SetClusterBackend(backend ClusterBackend) {
+	s.cluster = newClusterState(backend, newServerId(s.logger), s.logger)
+	go s.runClusterEventLoop()
+
+	// Backends that support leader election (currently just etcd) restrict
+	// ban sweeping to the node that holds the election. Every node keeps its
+	// own BanStore, so on the other nodes expired bans stay in the store and
+	// its file; Matching and List skip them.
+	if leader, ok := backend.(interface{ IsLeader() bool }); ok {
+		s.ban_store.SetSweepGate(leader.IsLeader)
+	}
+}
+
+func (s *Server) runClusterEventLoop() {
+	for event := range s.cluster.backend.Subscribe() {
+		if event.ServerId == s.cluster.serverId {
+			continue // Loopback of our own event.
+		}
+		s.cluster.apply(event)
+		switch event.Type {
+		case ClusterEventChat:
+			if event.TargetServer != "" && event.TargetServer != s.cluster.serverId {
+				continue
+			}
+			if event.Receiver == "" {
+				s.broadcastToConnectedClients("CHAT", event.Sender, event.Message, "public")
+			} else if recv_client := s.isLoggedIn(event.Receiver); recv_client != nil {
+				recv_client.SendPacket("CHAT", event.Sender, event.Message, "private")
+			}
+		case ClusterEventPresenceJoin, ClusterEventPresenceLeave:
+			s.broadcastToConnectedClients("CLIENTS_UPDATE")
+		case ClusterEventMotdSet:
+			s.motd = event.Message
+			s.broadcastToConnectedClients("CHAT", "", s.motd, "system")
+		case ClusterEventBanAdd:
+			var duration time.Duration
+			if !event.BanExpiry.IsZero() {
+				duration = time.Until(event.BanExpiry)
+			}
+			s.ban_store.Add(event.BanKind, event.BanValue, duration)
+			s.disconnectMatchingBan(event.BanKind, event.BanValue)
+		case ClusterEventBanRemove:
+			s.ban_store.Remove(event.BanKind, event.BanValue)
+		}
+	}
+}
+
+// disconnectMatchingBan disconnects every locally connected client matching
+// kind/value. It only disconnects; as everywhere else, the dealWithClient
+// goroutine already running for each of these clients is solely responsible
+// for removing it from s.clients and publishing the CLIENTS_UPDATE/
+// presence_leave side effects exactly once.
+func (s *Server) disconnectMatchingBan(kind BanKind, value string) {
+	for e := s.clients.Front(); e != nil; e = e.Next() {
+		if matchesBan(e.Value.(*Client), kind, value) {
+			banned := e.Value.(*Client)
+			banned.SendPacket("DISCONNECT", "BANNED")
+			banned.Disconnect()
+		}
+	}
 }
 
 func (s *Server) Shutdown() error {
@@ -45,6 +199,66 @@ func (s *Server) SetPingCycleTime(d time.Duration) {
 	s.pingCycleTime = d
 }
 
+func (s *Server) SetLoginTimeout(d time.Duration) {
+	s.loginTimeout = d
+}
+
+// SetChatRateLimit configures the per-client token bucket guarding
+// HandleCHAT: rate tokens per second are added, up to burst outstanding.
+// It only takes effect for clients connecting after the call.
+func (s *Server) SetChatRateLimit(rate, burst float64) {
+	s.chatLimiterRate = rate
+	s.chatLimiterBurst = burst
+}
+
+// SetLoginRateLimit configures the per-remote-IP token bucket guarding
+// HandleLOGIN. It updates the limiter already wired into
+// CreateServerUsing's pruner goroutine in place, rather than replacing it,
+// so the pruner keeps running against the live map.
+func (s *Server) SetLoginRateLimit(rate, burst float64) {
+	s.loginLimiters.SetRateBurst(rate, burst)
+}
+
+// registerChatLimiter creates client's chat rate limiter. Called once the
+// client's connection is accepted.
+func (s *Server) registerChatLimiter(client *Client) {
+	s.chatLimitersMutex.Lock()
+	defer s.chatLimitersMutex.Unlock()
+	s.chatLimiters[client] = NewRateLimiter(s.chatLimiterRate, s.chatLimiterBurst)
+}
+
+// unregisterChatLimiter forgets client's chat rate limiter. Called once the
+// client disconnects.
+func (s *Server) unregisterChatLimiter(client *Client) {
+	s.chatLimitersMutex.Lock()
+	defer s.chatLimitersMutex.Unlock()
+	delete(s.chatLimiters, client)
+}
+
+func (s *Server) chatAllowed(client *Client) bool {
+	s.chatLimitersMutex.Lock()
+	limiter, found := s.chatLimiters[client]
+	s.chatLimitersMutex.Unlock()
+	if !found {
+		return true
+	}
+	return limiter.Allow()
+}
+
+// remoteIp returns client's remote address with any "host:port" port
+// stripped, so it can be used as a ban/rate-limit key that identifies the
+// attacker rather than the single TCP connection: RemoteAddr() carries an
+// ephemeral port that changes on every reconnect. If the address has no
+// port (or fails to parse, e.g. for transports that don't use host:port),
+// it is returned unchanged.
+func remoteIp(client *Client) string {
+	host, _, err := net.SplitHostPort(client.RemoteAddr())
+	if err != nil {
+		return client.RemoteAddr()
+	}
+	return host
+}
+
 func (s *Server) isLoggedIn(name string) *Client {
 	for e := s.clients.Front(); e != nil; e = e.Next() {
 		client := e.Value.(*Client)
@@ -56,7 +270,7 @@ func (s *Server) isLoggedIn(name string) *Client {
 }
 
 func (s *Server) mainLoop() error {
-	log.Print("Starting Goroutine: mainLoop")
+	s.logger.Debugw("starting goroutine", "goroutine", "mainLoop")
 	for done := false; !done; {
 		select {
 		case conn, ok := <-s.acceptedConnections:
@@ -69,7 +283,7 @@ func (s *Server) mainLoop() error {
 			done = true
 		}
 	}
-	log.Print("Ending Goroutine: mainLoop")
+	s.logger.Debugw("ending goroutine", "goroutine", "mainLoop")
 	s.shutdown()
 	return nil
 }
@@ -81,22 +295,38 @@ func (s *Server) shutdown() error {
 		s.clients.Remove(e)
 	}
 	close(s.acceptedConnections)
+	s.banSweeperStop <- true
+	s.loginLimiterPruneStop <- true
 	s.serverHasShutdown <- true
 	return nil
 }
 
+// stopAndDrainTimer stops t, draining its channel if it had already fired,
+// so it is safe to Reset afterwards without races per the time.Timer docs.
+func stopAndDrainTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
 func (s *Server) dealWithClient(client *Client) {
-	log.Print("Starting Goroutine: dealWithClient")
-	timeout_channel := make(chan bool)
+	s.registerClientLogger(client)
+	s.clientLogger(client).Debugw("starting goroutine", "goroutine", "dealWithClient")
+	s.registerChatLimiter(client)
+	sendingTimer := time.NewTimer(s.clientSendingTimeout)
 	startToPingTimer := time.NewTimer(s.pingCycleTime)
+	loginTimer := time.NewTimer(s.loginTimeout)
 	waitingForPong := false
 
 	for done := false; !done; {
-		time.AfterFunc(s.clientSendingTimeout, func() {
-			timeout_channel <- true
-		})
 		select {
 		case pkg, ok := <-client.DataStream:
+			stopAndDrainTimer(sendingTimer)
+			sendingTimer.Reset(s.clientSendingTimeout)
+
 			if !ok {
 				done = true
 				break
@@ -119,16 +349,18 @@ func (s *Server) dealWithClient(client *Client) {
 					client.SendPacket("ERROR", cmdName, errString)
 				}
 			} else {
-				log.Printf("%s: Garbage packet %s", client.Name(), cmdName)
+				s.clientLogger(client).Warnw("garbage packet received", "cmd", cmdName)
 				client.SendPacket("ERROR", "GARBAGE_RECEIVED", "INVALID_CMD")
 				client.Disconnect()
 				done = true
 			}
-		case <-timeout_channel:
+		case <-sendingTimer.C:
+			sendingTimer.Reset(s.clientSendingTimeout)
 			client.SendPacket("DISCONNECT", "CLIENT_TIMEOUT")
 			done = true
 		case <-startToPingTimer.C:
 			if waitingForPong {
+				s.clientLogger(client).Warnw("ping timeout")
 				client.SendPacket("DISCONNECT", "CLIENT_TIMEOUT")
 				done = true
 				break
@@ -136,20 +368,43 @@ func (s *Server) dealWithClient(client *Client) {
 			client.SendPacket("PING")
 			waitingForPong = true
 			startToPingTimer.Reset(s.pingCycleTime)
+		case <-loginTimer.C:
+			if client.State() != CONNECTED {
+				client.SendPacket("DISCONNECT", "CLIENT_TIMEOUT")
+				done = true
+			}
 		}
 	}
+	stopAndDrainTimer(sendingTimer)
+	startToPingTimer.Stop()
+	loginTimer.Stop()
 	client.Disconnect()
-	log.Print("Ending Goroutine: dealWithClient")
+	s.clientLogger(client).Debugw("ending goroutine", "goroutine", "dealWithClient")
+	s.unregisterChatLimiter(client)
+	s.unregisterClientLogger(client)
 
+	wasConnected := false
 	for e := s.clients.Front(); e != nil; e = e.Next() {
 		if e.Value.(*Client) == client {
 			s.clients.Remove(e)
+			wasConnected = true
+			break
 		}
 	}
-	s.broadcastToConnectedClients("CLIENTS_UPDATE")
+	// A client that never completed LOGIN (failed/rate-limited/banned/garbage
+	// before reaching CONNECTED) was never added to s.clients and never
+	// published a presence_join, so there is nothing to announce here.
+	if wasConnected {
+		s.broadcastToConnectedClients("CLIENTS_UPDATE")
+		s.cluster.publish(ClusterEvent{Type: ClusterEventPresenceLeave, Sender: client.Name()})
+	}
 }
 
 func (s *Server) HandleCHAT(client *Client, pkg *packet.Packet) (string, bool) {
+	if !s.chatAllowed(client) {
+		return "RATE_LIMITED", false
+	}
+
 	message, err := pkg.ReadString()
 	if err != nil {
 		return err.Error(), false
@@ -164,10 +419,13 @@ func (s *Server) HandleCHAT(client *Client, pkg *packet.Packet) (string, bool) {
 
 	if len(receiver) == 0 {
 		s.broadcastToConnectedClients("CHAT", client.Name(), message, "public")
+		s.cluster.publish(ClusterEvent{Type: ClusterEventChat, Sender: client.Name(), Message: message})
 	} else {
 		recv_client := s.isLoggedIn(receiver)
 		if recv_client != nil {
 			recv_client.SendPacket("CHAT", client.Name(), message, "private")
+		} else if remote, found := s.cluster.findRemote(receiver); found {
+			s.cluster.publish(ClusterEvent{Type: ClusterEventChat, Sender: client.Name(), Message: message, Receiver: receiver, TargetServer: remote.serverId})
 		}
 	}
 	return "", false
@@ -184,16 +442,100 @@ func (s *Server) HandleMOTD(client *Client, pkg *packet.Packet) (string, bool) {
 	}
 	s.motd = message
 	s.broadcastToConnectedClients("CHAT", "", s.motd, "system")
+	s.cluster.publish(ClusterEvent{Type: ClusterEventMotdSet, Message: s.motd})
+
+	return "", false
+}
+
+func (s *Server) HandleBAN(client *Client, pkg *packet.Packet) (string, bool) {
+	if client.Permissions() != SUPERUSER {
+		return "DEFICIENT_PERMISSION", false
+	}
+
+	kind, err := pkg.ReadString()
+	if err != nil {
+		return err.Error(), false
+	}
+	value, err := pkg.ReadString()
+	if err != nil {
+		return err.Error(), false
+	}
+	durationSeconds, err := pkg.ReadInt()
+	if err != nil {
+		return err.Error(), false
+	}
+
+	duration := time.Duration(durationSeconds) * time.Second
+	s.ban_store.Add(BanKind(kind), value, duration)
+
+	var expiry time.Time
+	if duration != 0 {
+		expiry = time.Now().Add(duration)
+	}
+	s.cluster.publish(ClusterEvent{Type: ClusterEventBanAdd, BanKind: BanKind(kind), BanValue: value, BanExpiry: expiry})
+	s.disconnectMatchingBan(BanKind(kind), value)
+
+	return "", false
+}
+
+func (s *Server) HandleUNBAN(client *Client, pkg *packet.Packet) (string, bool) {
+	if client.Permissions() != SUPERUSER {
+		return "DEFICIENT_PERMISSION", false
+	}
+
+	kind, err := pkg.ReadString()
+	if err != nil {
+		return err.Error(), false
+	}
+	value, err := pkg.ReadString()
+	if err != nil {
+		return err.Error(), false
+	}
+
+	if !s.ban_store.Remove(BanKind(kind), value) {
+		return "NOT_BANNED", false
+	}
+	s.cluster.publish(ClusterEvent{Type: ClusterEventBanRemove, BanKind: BanKind(kind), BanValue: value})
+	return "", false
+}
 
+func (s *Server) HandleBANLIST(client *Client, pkg *packet.Packet) (string, bool) {
+	if client.Permissions() != SUPERUSER {
+		return "DEFICIENT_PERMISSION", false
+	}
+
+	bans := s.ban_store.List()
+	client.SendPacket("BANLIST_BEGIN", len(bans))
+	for _, ban := range bans {
+		expiry := int64(0)
+		if !ban.Expiry.IsZero() {
+			expiry = ban.Expiry.Unix()
+		}
+		client.SendPacket("BANLIST_ENTRY", string(ban.Kind), ban.Value, expiry)
+	}
 	return "", false
 }
 
+// matchesBan reports whether client is affected by a ban of the given kind
+// and value.
+func matchesBan(client *Client, kind BanKind, value string) bool {
+	switch kind {
+	case BanByName:
+		return client.Name() == value
+	case BanByIp:
+		return remoteIp(client) == value
+	case BanByBuildId:
+		return client.BuildId() == value
+	}
+	return false
+}
+
 func (s *Server) HandleDISCONNECT(client *Client, pkg *packet.Packet) (string, bool) {
 	reason, err := pkg.ReadString()
 	if err != nil {
 		return err.Error(), true
 	}
-	log.Printf("%s: leaving. Reason: '%s'", client.Name(), reason)
+	s.clientLogger(client).Infow("client left", "reason", reason)
 	return "", true
 }
 
@@ -202,6 +544,11 @@ func (s *Server) HandlePONG(client *Client, pkg *packet.Packet) (string, bool) {
 }
 
 func (s *Server) HandleLOGIN(client *Client, pkg *packet.Packet) (string, bool) {
+	if !s.loginLimiters.Allow(remoteIp(client)) {
+		s.logger.Warnw("login throttled", "remote_addr", client.RemoteAddr())
+		return "THROTTLED", true
+	}
+
 	protocolVersion, err := pkg.ReadInt()
 	if err != nil {
 		return err.Error(), true
@@ -225,11 +572,18 @@ func (s *Server) HandleLOGIN(client *Client, pkg *packet.Packet) (string, bool)
 		return err.Error(), true
 	}
 
+	if ban := s.ban_store.Matching(userName, remoteIp(client), buildId); ban != nil {
+		s.logger.Warnw("login rejected: banned", "remote_addr", client.RemoteAddr(), "user", userName, "build_id", buildId, "ban_kind", ban.Kind)
+		return "BANNED", true
+	}
+
 	if isRegisteredOnServer {
-		if s.isLoggedIn(userName) != nil {
+		if s.isLoggedIn(userName) != nil || s.cluster.isLoggedInRemotely(userName) {
+			s.logger.Infow("login rejected: already logged in", "remote_addr", client.RemoteAddr(), "user", userName)
 			return "ALREADY_LOGGED_IN", true
 		}
 		if !s.user_db.ContainsName(userName) {
+			s.logger.Infow("login rejected: unknown user", "remote_addr", client.RemoteAddr(), "user", userName)
 			return "WRONG_PASSWORD", true
 		}
 		password, err := pkg.ReadString()
@@ -237,12 +591,13 @@ func (s *Server) HandleLOGIN(client *Client, pkg *packet.Packet) (string, bool)
 			return err.Error(), true
 		}
 		if !s.user_db.PasswordCorrect(userName, password) {
+			s.logger.Infow("login rejected: wrong password", "remote_addr", client.RemoteAddr(), "user", userName)
 			return "WRONG_PASSWORD", true
 		}
 		client.SetPermissions(s.user_db.Permissions(userName))
 	} else {
 		baseName := userName
-		for i := 1; s.user_db.ContainsName(userName) || s.isLoggedIn(userName) != nil; i++ {
+		for i := 1; s.user_db.ContainsName(userName) || s.isLoggedIn(userName) != nil || s.cluster.isLoggedInRemotely(userName); i++ {
 			userName = fmt.Sprintf("%s%d", baseName, i)
 		}
 	}
@@ -251,11 +606,19 @@ func (s *Server) HandleLOGIN(client *Client, pkg *packet.Packet) (string, bool)
 	client.SetName(userName)
 	client.SetLoginTime(time.Now())
 	client.SetState(CONNECTED)
+	s.promoteClientLogger(client)
 
 	client.SendPacket("LOGIN", userName, client.Permissions().String())
 	client.SendPacket("TIME", int(time.Now().Unix()))
+	s.clientLogger(client).Infow("login succeeded")
 	s.clients.PushBack(client)
 	s.broadcastToConnectedClients("CLIENTS_UPDATE")
+	s.cluster.publish(ClusterEvent{
+		Type:        ClusterEventPresenceJoin,
+		Sender:      userName,
+		BuildId:     buildId,
+		Permissions: client.Permissions(),
+	})
 
 	if len(s.motd) != 0 {
 		client.SendPacket("CHAT", "", s.motd, "system")
@@ -273,39 +636,73 @@ func (s *Server) broadcastToConnectedClients(data ...interface{}) {
 	}
 }
 
-func listeningLoop(C chan io.ReadWriteCloser) {
-	ln, err := net.Listen("tcp", ":7395") // TODO(sirver): softcode this
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			break
-		}
-		C <- conn
+// defaultListenerConfigs is used by CreateServer, which exists mostly for
+// tests and simple invocations; operators that need WebSocket support should
+// call CreateServerUsingListeners directly.
+func defaultListenerConfigs() []ListenerConfig {
+	return []ListenerConfig{
+		{Scheme: "tcp", Addr: ":7395"},
 	}
 }
+
 func CreateServer() *Server {
 	// NOCOM(sirver): should use a proper database connection or flat file
+	return CreateServerUsingListeners(defaultListenerConfigs(), NewInMemoryDb())
+}
+
+// CreateServerUsingListeners binds every listener described by configs
+// (e.g. "tcp://:7395", "ws://:7396/metaserver", "wss://:7397/metaserver")
+// and feeds accepted connections into a single server instance.
+func CreateServerUsingListeners(configs []ListenerConfig, db UserDb) *Server {
+	logger, err := NewZapLogger("info", LogEncodingConsole)
+	if err != nil {
+		log.Fatalf("could not build default logger: %v", err)
+	}
+
 	C := make(chan io.ReadWriteCloser)
-	// NOCOM(sirver): no way to stop the listening loop right now
-	go listeningLoop(C)
-	return CreateServerUsing(C, NewInMemoryDb())
+	// NOCOM(sirver): no way to stop the listening loops right now
+	for _, config := range configs {
+		config := config
+		go func() {
+			if err := listenAndServe(config, C, logger); err != nil {
+				logger.Errorw("listener failed", "scheme", config.Scheme, "addr", config.Addr, "error", err)
+			}
+		}()
+	}
+	return CreateServerUsing(C, db, WithLogger(logger))
 }
 
-func CreateServerUsing(acceptedConnections chan io.ReadWriteCloser, db UserDb) *Server {
+func CreateServerUsing(acceptedConnections chan io.ReadWriteCloser, db UserDb, opts ...ServerOption) *Server {
+	defaultLogger, err := NewZapLogger("info", LogEncodingConsole)
+	if err != nil {
+		log.Fatalf("could not build default logger: %v", err)
+	}
+
 	server := &Server{
-		acceptedConnections:  acceptedConnections,
-		shutdownServer:       make(chan bool),
-		serverHasShutdown:    make(chan bool),
-		clients:              list.New(),
-		user_db:              db,
-		clientSendingTimeout: time.Second * 30,
-		pingCycleTime:        time.Second * 15,
+		acceptedConnections:   acceptedConnections,
+		shutdownServer:        make(chan bool),
+		serverHasShutdown:     make(chan bool),
+		clients:               list.New(),
+		user_db:               db,
+		banSweeperStop:        make(chan bool),
+		logger:                defaultLogger,
+		clientLoggers:         make(map[*Client]Logger),
+		chatLimiters:          make(map[*Client]*RateLimiter),
+		chatLimiterRate:       1,
+		chatLimiterBurst:      5,
+		loginLimiters:         newKeyedRateLimiters(5.0/60.0, 5),
+		loginLimiterPruneStop: make(chan bool),
+		clientSendingTimeout:  time.Second * 30,
+		pingCycleTime:         time.Second * 15,
+		loginTimeout:          time.Second * 30,
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	server.ban_store = NewBanStore("bans.json", server.logger)
 
+	go server.ban_store.RunSweeper(time.Minute, server.banSweeperStop)
+	go server.loginLimiters.RunPruner(time.Minute, 10*time.Minute, server.loginLimiterPruneStop)
 	go server.mainLoop()
 	return server
-}
\ No newline at end of file
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// ListenerConfig describes a single address the server should accept
+// connections on. Scheme is one of "tcp", "ws", or "wss"; Addr is the
+// host:port to bind to, and Path (ws/wss only) is the HTTP path the
+// WebSocket upgrade is served on.
+type ListenerConfig struct {
+	Scheme   string
+	Addr     string
+	Path     string
+	CertFile string
+	KeyFile  string
+
+	// AllowedOrigins restricts which Origin header values a ws/wss listener
+	// will accept the WebSocket upgrade from. Empty means same-origin only,
+	// via gorilla/websocket's own default CheckOrigin; use []string{"*"} to
+	// accept any origin (e.g. for non-browser clients that send no Origin
+	// header, or during local development).
+	AllowedOrigins []string
+}
+
+// Transport is anything that can be turned into the io.ReadWriteCloser the
+// server already speaks length-prefixed packets over. net.Conn satisfies it
+// directly; wsConn adapts a WebSocket connection to the same interface.
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// wsConn adapts a gorilla/websocket connection to io.ReadWriteCloser by
+// concatenating the payloads of binary messages into a single byte stream,
+// which is what the packet reader on top of it expects.
+type wsConn struct {
+	conn    *websocket.Conn
+	pending []byte
+}
+
+func newWsConn(conn *websocket.Conn) *wsConn {
+	return &wsConn{conn: conn}
+}
+
+func (w *wsConn) Read(p []byte) (int, error) {
+	for len(w.pending) == 0 {
+		_, data, err := w.conn.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		w.pending = data
+	}
+	n := copy(p, w.pending)
+	w.pending = w.pending[n:]
+	return n, nil
+}
+
+func (w *wsConn) Write(p []byte) (int, error) {
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *wsConn) Close() error {
+	return w.conn.Close()
+}
+
+// checkOrigin builds a websocket.Upgrader.CheckOrigin func honoring
+// config.AllowedOrigins. A nil/empty list leaves CheckOrigin unset so
+// gorilla/websocket falls back to its own same-origin check; "*" accepts
+// every origin.
+func checkOrigin(config ListenerConfig) func(r *http.Request) bool {
+	if len(config.AllowedOrigins) == 0 {
+		return nil
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			return func(r *http.Request) bool { return true }
+		}
+	}
+	allowed := make(map[string]bool, len(config.AllowedOrigins))
+	for _, origin := range config.AllowedOrigins {
+		allowed[origin] = true
+	}
+	return func(r *http.Request) bool {
+		return allowed[r.Header.Get("Origin")]
+	}
+}
+
+// listenAndServe starts accepting connections described by config, pushing
+// each newly accepted Transport onto C. It blocks until the listener fails.
+func listenAndServe(config ListenerConfig, C chan io.ReadWriteCloser, logger Logger) error {
+	switch config.Scheme {
+	case "tcp":
+		return listenTcp(config.Addr, C)
+	case "ws":
+		return listenWebsocket(config, C, false, logger)
+	case "wss":
+		return listenWebsocket(config, C, true, logger)
+	default:
+		return fmt.Errorf("unknown listener scheme %q", config.Scheme)
+	}
+}
+
+func listenTcp(addr string, C chan io.ReadWriteCloser) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		C <- conn
+	}
+}
+
+func listenWebsocket(config ListenerConfig, C chan io.ReadWriteCloser, tls bool, logger Logger) error {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin:     checkOrigin(config),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(config.Path, func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Warnw("websocket upgrade failed", "error", err)
+			return
+		}
+		C <- newWsConn(conn)
+	})
+	if tls {
+		return http.ListenAndServeTLS(config.Addr, config.CertFile, config.KeyFile, mux)
+	}
+	return http.ListenAndServe(config.Addr, mux)
+}